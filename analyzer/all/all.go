@@ -0,0 +1,8 @@
+// Package all blank-imports every analyzer so its init() registers with the
+// analyzer package just by importing this package, as cmd/fanal/main.go does.
+package all
+
+import (
+	_ "github.com/aquasecurity/fanal/analyzer/os/openeuler"
+	_ "github.com/aquasecurity/fanal/analyzer/pkg/rpm/openeuler"
+)
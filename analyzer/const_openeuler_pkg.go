@@ -0,0 +1,6 @@
+package analyzer
+
+// TypeOpenEulerPkg is reported by the openEuler RPM package analyzer
+// (analyzer/pkg/rpm/openeuler) for packages recovered from an openEuler
+// image's rpm database.
+const TypeOpenEulerPkg Type = "openeuler-pkg"
@@ -0,0 +1,33 @@
+package analyzer
+
+import (
+	"os"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// globAnalyzer wraps an Analyzer so Required matches filePath against a set
+// of doublestar patterns (e.g. "**/*.jar", "etc/**/*.conf") instead of
+// whatever fixed check the wrapped Analyzer implements, for analyzers whose
+// required files vary by shape rather than being a small, fixed list.
+type globAnalyzer struct {
+	Analyzer
+	patterns []string
+}
+
+func (a globAnalyzer) Required(filePath string, _ os.FileInfo) bool {
+	for _, p := range a.patterns {
+		if ok, _ := doublestar.Match(p, filePath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisterAnalyzerWithGlob registers a like RegisterAnalyzer, except its
+// Required is replaced by a doublestar glob match against patterns, for
+// analyzers that want to declare their required files by pattern (e.g.
+// "**/*.pom") instead of an exact path list.
+func RegisterAnalyzerWithGlob(a Analyzer, patterns []string) {
+	RegisterAnalyzer(globAnalyzer{Analyzer: a, patterns: patterns})
+}
@@ -0,0 +1,139 @@
+package openeuler
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	rpmdb "github.com/knqyf263/go-rpmdb/pkg"
+	"golang.org/x/xerrors"
+
+	"github.com/aquasecurity/fanal/analyzer"
+	"github.com/aquasecurity/fanal/types"
+	"github.com/aquasecurity/fanal/utils"
+)
+
+func init() {
+	analyzer.RegisterAnalyzer(&openeulerPkgAnalyzer{})
+}
+
+const version = 1
+
+// requiredFiles covers both rpmdb backends openEuler has shipped: the classic
+// Berkeley DB file, and the sqlite backend used since openEuler 22.03 LTS SP1.
+// go-rpmdb auto-detects which one it was handed, so Analyze doesn't need to
+// branch on the backend itself.
+var requiredFiles = []string{
+	"var/lib/rpm/Packages",
+	"var/lib/rpm/rpmdb.sqlite",
+}
+
+type openeulerPkgAnalyzer struct{}
+
+func (a openeulerPkgAnalyzer) Analyze(_ context.Context, input analyzer.AnalysisInput) (*analyzer.AnalysisResult, error) {
+	// go-rpmdb needs a real file to mmap/open, so spill the DB to a temp file
+	// the same way the os-release analyzer's caller does for large files.
+	f, err := ioutil.TempFile("", "openeuler-rpmdb-*")
+	if err != nil {
+		return nil, xerrors.Errorf("failed to create a temp file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.ReadFrom(input.Content); err != nil {
+		return nil, xerrors.Errorf("failed to read the rpm db: %w", err)
+	}
+
+	db, err := rpmdb.Open(f.Name())
+	if err != nil {
+		return nil, xerrors.Errorf("failed to open the rpm db: %w", err)
+	}
+	defer db.Close()
+
+	pkgList, err := db.ListPackages()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to list packages: %w", err)
+	}
+
+	var pkgs []types.Package
+	for _, pkg := range pkgList {
+		p := types.Package{
+			Name:            pkg.Name,
+			Version:         pkg.Version,
+			Release:         pkg.Release,
+			Epoch:           pkg.EpochNum(),
+			Arch:            pkg.Arch,
+			License:         pkg.License,
+			Modularitylabel: pkg.Modularitylabel,
+		}
+
+		// Source packages (e.g. "gpg-pubkey" entries) have no SourceRpm; leave
+		// the Src* fields empty for those rather than parsing an empty string.
+		// A SourceRpm that doesn't match the expected shape also just leaves
+		// them empty - one odd entry shouldn't wipe out every other package
+		// rpmdb reported for this image.
+		if pkg.SourceRpm != "" && pkg.SourceRpm != "(none)" {
+			if srcName, srcVer, srcRel, err := splitSourceRPM(pkg.SourceRpm); err == nil {
+				p.SrcName = srcName
+				p.SrcVersion = srcVer
+				p.SrcRelease = srcRel
+				p.SrcEpoch = pkg.EpochNum()
+			}
+		}
+
+		pkgs = append(pkgs, p)
+	}
+
+	return &analyzer.AnalysisResult{
+		PackageInfos: []types.PackageInfo{
+			{
+				FilePath: input.FilePath,
+				Packages: pkgs,
+			},
+		},
+	}, nil
+}
+
+// splitSourceRPM parses a "<name>-<version>-<release>.<dist>.src.rpm" filename
+// (the format rpmdb stores in a binary package's SourceRpm field) into its
+// name, version and release, the same fields downstream vulnerability
+// matching looks up a source package by. Epoch isn't encoded in the filename,
+// so callers fall back to the binary package's own epoch.
+func splitSourceRPM(sourceRPM string) (name, version, release string, err error) {
+	filename := strings.TrimSuffix(sourceRPM, ".src.rpm")
+	if filename == sourceRPM {
+		return "", "", "", xerrors.Errorf("%q is not a source rpm filename", sourceRPM)
+	}
+
+	relIdx := strings.LastIndex(filename, "-")
+	if relIdx == -1 {
+		return "", "", "", xerrors.Errorf("%q: missing release", sourceRPM)
+	}
+	release = filename[relIdx+1:]
+
+	verIdx := strings.LastIndex(filename[:relIdx], "-")
+	if verIdx == -1 {
+		return "", "", "", xerrors.Errorf("%q: missing version", sourceRPM)
+	}
+	version = filename[verIdx+1 : relIdx]
+	name = filename[:verIdx]
+
+	return name, version, release, nil
+}
+
+// Required matches either rpmdb backend; the OS family linkage to openEuler
+// that downstream vulnerability matching relies on comes from the os-release
+// analyzer (analyzer/os/openeuler) already having set types.OS.Family for the
+// same image, not from anything checked here.
+func (a openeulerPkgAnalyzer) Required(filePath string, _ os.FileInfo) bool {
+	return utils.StringInSlice(filePath, requiredFiles)
+}
+
+func (a openeulerPkgAnalyzer) Type() analyzer.Type {
+	return analyzer.TypeOpenEulerPkg
+}
+
+func (a openeulerPkgAnalyzer) Version() int {
+	return version
+}
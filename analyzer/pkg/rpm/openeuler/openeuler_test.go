@@ -0,0 +1,52 @@
+package openeuler
+
+import "testing"
+
+func TestSplitSourceRPM(t *testing.T) {
+	tests := []struct {
+		sourceRPM   string
+		wantName    string
+		wantVersion string
+		wantRelease string
+		wantErr     bool
+	}{
+		{
+			sourceRPM:   "bash-4.4.23-1.oe1.src.rpm",
+			wantName:    "bash",
+			wantVersion: "4.4.23",
+			wantRelease: "1.oe1",
+		},
+		{
+			sourceRPM:   "openssl-1.1.1f-1.oe1.src.rpm",
+			wantName:    "openssl",
+			wantVersion: "1.1.1f",
+			wantRelease: "1.oe1",
+		},
+		{
+			sourceRPM: "not-a-source-rpm",
+			wantErr:   true,
+		},
+		{
+			sourceRPM: "name-only.src.rpm",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		name, version, release, err := splitSourceRPM(tt.sourceRPM)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("splitSourceRPM(%q): want error, got none", tt.sourceRPM)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("splitSourceRPM(%q): unexpected error: %v", tt.sourceRPM, err)
+			continue
+		}
+		if name != tt.wantName || version != tt.wantVersion || release != tt.wantRelease {
+			t.Errorf("splitSourceRPM(%q) = (%q, %q, %q), want (%q, %q, %q)",
+				tt.sourceRPM, name, version, release, tt.wantName, tt.wantVersion, tt.wantRelease)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package sync
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/aquasecurity/fanal/artifact/sync/syncpb"
+)
+
+// grpcTransport adapts the client end of the bidi stream generated from
+// sync.proto to Transport. Only SendMeta and RecvRequest work on it; the server
+// end is wrapped by grpcServerTransport instead.
+type grpcTransport struct {
+	stream syncpb.Sync_SessionClient
+}
+
+// NewGRPCTransport wraps a Sync_SessionClient (as returned by a generated
+// syncpb.SyncClient.Session call) as a Transport for the client side of a sync.
+func NewGRPCTransport(stream syncpb.Sync_SessionClient) Transport {
+	return grpcTransport{stream: stream}
+}
+
+func (t grpcTransport) SendMeta(m FileMeta) error {
+	return t.stream.Send(&syncpb.FileMeta{
+		Path:        m.Path,
+		Mode:        uint32(m.Mode),
+		ModTimeUnix: m.ModTime.Unix(),
+		Size:        m.Size,
+		Digest:      m.Digest,
+		Content:     m.Content,
+	})
+}
+
+func (t grpcTransport) RecvRequest() (FileRequest, error) {
+	req, err := t.stream.Recv()
+	if err == io.EOF {
+		return FileRequest{Done: true}, nil
+	} else if err != nil {
+		return FileRequest{}, xerrors.Errorf("failed to receive from the sync stream: %w", err)
+	}
+	return FileRequest{Path: req.Path, Done: req.Done, BlobID: req.BlobId}, nil
+}
+
+func (t grpcTransport) RecvMeta() (FileMeta, error) {
+	return FileMeta{}, xerrors.New("RecvMeta is only implemented on the server side of the sync stream")
+}
+
+func (t grpcTransport) SendRequest(FileRequest) error {
+	return xerrors.New("SendRequest is only implemented on the server side of the sync stream")
+}
+
+// grpcServerTransport is grpcTransport's counterpart for the server half of
+// the bidi stream: a syncpb.SyncServer implementation gets one of these per
+// inbound Session call.
+type grpcServerTransport struct {
+	stream syncpb.Sync_SessionServer
+}
+
+// NewGRPCServerTransport wraps a Sync_SessionServer (the stream a generated
+// syncpb.SyncServer.Session implementation receives per call) as a Transport
+// for the server side of a sync.
+func NewGRPCServerTransport(stream syncpb.Sync_SessionServer) Transport {
+	return grpcServerTransport{stream: stream}
+}
+
+func (t grpcServerTransport) RecvMeta() (FileMeta, error) {
+	m, err := t.stream.Recv()
+	if err == io.EOF {
+		return FileMeta{}, io.EOF
+	} else if err != nil {
+		return FileMeta{}, xerrors.Errorf("failed to receive from the sync stream: %w", err)
+	}
+	return FileMeta{
+		Path:    m.Path,
+		Mode:    os.FileMode(m.Mode),
+		ModTime: time.Unix(m.ModTimeUnix, 0),
+		Size:    m.Size,
+		Digest:  m.Digest,
+		Content: m.Content,
+	}, nil
+}
+
+func (t grpcServerTransport) SendRequest(r FileRequest) error {
+	return t.stream.Send(&syncpb.FileRequest{Path: r.Path, Done: r.Done, BlobId: r.BlobID})
+}
+
+func (t grpcServerTransport) SendMeta(FileMeta) error {
+	return xerrors.New("SendMeta is only implemented on the client side of the sync stream")
+}
+
+func (t grpcServerTransport) RecvRequest() (FileRequest, error) {
+	return FileRequest{}, xerrors.New("RecvRequest is only implemented on the client side of the sync stream")
+}
@@ -0,0 +1,44 @@
+package sync
+
+import (
+	"io"
+
+	"golang.org/x/xerrors"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/aquasecurity/fanal/analyzer"
+	"github.com/aquasecurity/fanal/artifact/sync/syncpb"
+	"github.com/aquasecurity/fanal/cache"
+)
+
+// SessionIDHeader is the gRPC metadata key a sync client must attach to the
+// outgoing context before dialing, so Service can derive the same sessionID
+// NewSession would otherwise need passed in out of band.
+const SessionIDHeader = "session-id"
+
+// Service implements syncpb.SyncServer, turning each inbound Session call
+// into a Session run against c. It's the piece cmd/fanal's sync-server
+// subcommand registers with a grpc.Server.
+type Service struct {
+	cache     cache.ArtifactCache
+	analyzeFn func(path string, content io.Reader) (*analyzer.AnalysisResult, error)
+}
+
+// NewService returns a syncpb.SyncServer that analyzes synced content with
+// analyzeFn and stores session/layer state in c.
+func NewService(c cache.ArtifactCache, analyzeFn func(path string, content io.Reader) (*analyzer.AnalysisResult, error)) Service {
+	return Service{cache: c, analyzeFn: analyzeFn}
+}
+
+// Session implements syncpb.SyncServer. It derives the session ID from the
+// SessionIDHeader metadata the client attached to the stream's context,
+// rather than from anything in the FileMeta stream itself.
+func (s Service) Session(stream syncpb.Sync_SessionServer) error {
+	md, ok := metadata.FromIncomingContext(stream.Context())
+	if !ok || len(md.Get(SessionIDHeader)) == 0 {
+		return xerrors.Errorf("missing %q metadata on the sync stream", SessionIDHeader)
+	}
+	sessionID := md.Get(SessionIDHeader)[0]
+
+	return NewSession(sessionID, s.cache, NewGRPCServerTransport(stream)).Run(s.analyzeFn)
+}
@@ -0,0 +1,353 @@
+// Package sync implements a session-based incremental sync artifact, modeled
+// on BuildKit's fscache: the client walks a local tree and streams
+// (path, mode, mtime, size, digest) tuples to a server instead of shipping the
+// whole tree on every scan, and the server asks back only for the paths whose
+// digest it hasn't already cached from a previous session. See sync.proto for
+// the wire format; this file is transport-agnostic and only depends on the
+// Transport interface below so it can run over gRPC (the intended transport)
+// or, for tests, an in-process pipe.
+package sync
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/xerrors"
+
+	"github.com/aquasecurity/fanal/analyzer"
+	"github.com/aquasecurity/fanal/artifact"
+	"github.com/aquasecurity/fanal/cache"
+	"github.com/aquasecurity/fanal/types"
+)
+
+// FileMeta is one entry of the client -> server stream described in
+// sync.proto's FileMeta message. Content is only set once the server has
+// asked for this path and the client is sending it a second time.
+type FileMeta struct {
+	Path    string
+	Mode    os.FileMode
+	ModTime time.Time
+	Size    int64
+	Digest  string
+	Content []byte
+}
+
+// FileRequest is one entry of the server -> client stream described in
+// sync.proto's FileRequest message. BlobID is only set on the final (Done)
+// message: the cache.ArtifactCache blob ID the server merged this round's
+// analyzer.AnalysisResult under, for the client to report back as part of its
+// types.ArtifactInfo.BlobIDs.
+type FileRequest struct {
+	Path   string
+	Done   bool
+	BlobID string
+}
+
+// Transport is the bidirectional stream a sync session runs over. grpc.go
+// adapts the client and server streams generated from sync.proto to it; tests
+// can satisfy it with a pair of channels.
+type Transport interface {
+	SendMeta(FileMeta) error
+	RecvRequest() (FileRequest, error)
+	RecvMeta() (FileMeta, error)
+	SendRequest(FileRequest) error
+}
+
+// sessionBucketPrefix is the cache.Cache bucket a sync session's per-file
+// state (last-seen digest plus the analyzer.AnalysisResult merged from it) is
+// stored under, scoped by a caller-supplied session ID so two clients syncing
+// the same path concurrently don't clobber each other's state.
+const sessionBucketPrefix = "sync-session-"
+
+// layerBlobBucket is the cache.Cache bucket a sync round's merged
+// analyzer.AnalysisResult is stored under, keyed by the blob ID Session.Run
+// hands back to the client so applier.ApplyLayers can retrieve it exactly the
+// way it retrieves any other artifact's layer blobs.
+const layerBlobBucket = "sync-layer"
+
+// Artifact is the client side of an incremental sync: it walks localRoot,
+// streams metadata for every file over t, re-sends the content of whatever the
+// server asks for, and returns a types.ArtifactInfo once the server confirms
+// it has everything it needs to analyze. It satisfies artifact.Artifact.
+type Artifact struct {
+	localRoot string
+	transport Transport
+	option    artifact.Option
+}
+
+// NewArtifact returns the client side of a sync session rooted at localRoot.
+func NewArtifact(localRoot string, t Transport, opt artifact.Option) (artifact.Artifact, error) {
+	abs, err := filepath.Abs(localRoot)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to resolve %s: %w", localRoot, err)
+	}
+	return Artifact{localRoot: abs, transport: t, option: opt}, nil
+}
+
+// Inspect walks the local tree, streams its metadata to the server, then
+// streams the content of whatever the server requests back. It returns once
+// the server signals Done, at which point the server has already applied the
+// synthetic "sync layer" and analyzed every new/changed file.
+func (a Artifact) Inspect(ctx context.Context) (types.ArtifactInfo, error) {
+	digests := make(map[string]string)
+
+	if err := filepath.Walk(a.localRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(a.localRoot, path)
+		if err != nil {
+			return err
+		}
+
+		digest, err := digestFile(path)
+		if err != nil {
+			return xerrors.Errorf("failed to hash %s: %w", path, err)
+		}
+		digests[rel] = digest
+
+		return a.transport.SendMeta(FileMeta{
+			Path:    rel,
+			Mode:    info.Mode(),
+			ModTime: info.ModTime(),
+			Size:    info.Size(),
+			Digest:  digest,
+		})
+	}); err != nil {
+		return types.ArtifactInfo{}, xerrors.Errorf("failed to walk %s: %w", a.localRoot, err)
+	}
+
+	var blobID string
+	for {
+		req, err := a.transport.RecvRequest()
+		if err != nil {
+			return types.ArtifactInfo{}, xerrors.Errorf("failed to receive a file request: %w", err)
+		}
+		if req.Done {
+			blobID = req.BlobID
+			break
+		}
+
+		content, err := os.ReadFile(filepath.Join(a.localRoot, req.Path))
+		if err != nil {
+			return types.ArtifactInfo{}, xerrors.Errorf("failed to read %s: %w", req.Path, err)
+		}
+		if err := a.transport.SendMeta(FileMeta{Path: req.Path, Digest: digests[req.Path], Content: content}); err != nil {
+			return types.ArtifactInfo{}, xerrors.Errorf("failed to send %s: %w", req.Path, err)
+		}
+	}
+
+	return types.ArtifactInfo{
+		SchemaVersion: types.ArtifactJSONSchemaVersion,
+		ID:            a.localRoot,
+		Name:          a.localRoot,
+		BlobIDs:       []string{blobID},
+	}, nil
+}
+
+func (a Artifact) Clean(_ types.ArtifactInfo) error { return nil }
+
+func digestFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Session is the server side of a sync round. It consumes the client's
+// metadata stream, requests content for any path whose digest it doesn't
+// already have cached under sessionID (from this or a prior round against the
+// same client), analyzes what it receives, and merges the result as a
+// synthetic layer via applier.ApplyLayers-compatible blob IDs.
+type Session struct {
+	sessionID string
+	cache     cache.ArtifactCache
+	transport Transport
+}
+
+// NewSession returns the server side of an incremental sync session. sessionID
+// should be stable across rounds from the same client (e.g. derived from the
+// local root's path) so unchanged files keep being recognized.
+func NewSession(sessionID string, c cache.ArtifactCache, t Transport) Session {
+	return Session{sessionID: sessionID, cache: c, transport: t}
+}
+
+// sessionEntry is what Session stores per path in its session-scoped cache
+// bucket: the digest seen for that path last round, and the
+// analyzer.AnalysisResult it produced, so an unchanged file on a later round
+// still contributes to the merged layer instead of just being skipped.
+type sessionEntry struct {
+	Digest string
+	Result *analyzer.AnalysisResult
+}
+
+// Run drains the client's metadata stream, asks for content on cache misses,
+// analyzes whatever comes back, and merges every file's result - fresh or
+// reused from a prior round - into one blob under layerBlobBucket, whose ID
+// it hands back to the client on the final Done message so applier.ApplyLayers
+// can treat this sync round as a synthetic layer.
+//
+// Receiving and sending run on separate goroutines connected by reqCh: RecvMeta
+// must never block on SendRequest, or a large enough tree fills the stream's
+// flow-control window with unread FileRequests and both sides hang forever
+// (the client can't drain FileRequests until it's done sending every FileMeta,
+// which it can't finish if the server has stopped calling RecvMeta to write
+// one of those FileRequests).
+func (s Session) Run(analyzeFn func(path string, content io.Reader) (*analyzer.AnalysisResult, error)) error {
+	bucket := sessionBucketPrefix + s.sessionID
+
+	eg, ctx := errgroup.WithContext(context.Background())
+	reqCh := make(chan FileRequest)
+
+	eg.Go(func() error {
+		defer close(reqCh)
+
+		var results []*analyzer.AnalysisResult
+		var digests []string
+
+		for {
+			meta, err := s.transport.RecvMeta()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return xerrors.Errorf("failed to receive file metadata: %w", err)
+			}
+
+			if meta.Content != nil {
+				result, err := analyzeFn(meta.Path, bytes.NewReader(meta.Content))
+				if err != nil {
+					return xerrors.Errorf("failed to analyze %s: %w", meta.Path, err)
+				}
+				if err := s.putEntry(bucket, meta.Path, sessionEntry{Digest: meta.Digest, Result: result}); err != nil {
+					return err
+				}
+				results = append(results, result)
+				digests = append(digests, meta.Digest)
+				continue
+			}
+
+			if entry, ok := s.getEntry(bucket, meta.Path); ok && entry.Digest == meta.Digest {
+				// Unchanged since the last round against this session: reuse
+				// the analyzer.AnalysisResult already merged from before.
+				results = append(results, entry.Result)
+				digests = append(digests, meta.Digest)
+				continue
+			}
+
+			select {
+			case reqCh <- FileRequest{Path: meta.Path}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		blobID := mergeBlobID(digests)
+		if err := s.putBlob(blobID, mergeResults(results)); err != nil {
+			return err
+		}
+
+		select {
+		case reqCh <- FileRequest{Done: true, BlobID: blobID}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return nil
+	})
+
+	eg.Go(func() error {
+		for req := range reqCh {
+			if err := s.transport.SendRequest(req); err != nil {
+				return xerrors.Errorf("failed to send a file request: %w", err)
+			}
+		}
+		return nil
+	})
+
+	return eg.Wait()
+}
+
+func (s Session) putEntry(bucket, path string, e sessionEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return xerrors.Errorf("failed to marshal the session entry for %s: %w", path, err)
+	}
+	if err := s.cache.PutBlob(bucket, path, b); err != nil {
+		return xerrors.Errorf("failed to cache the session entry for %s: %w", path, err)
+	}
+	return nil
+}
+
+func (s Session) getEntry(bucket, path string) (sessionEntry, bool) {
+	b, err := s.cache.GetBlob(bucket, path)
+	if err != nil || b == nil {
+		return sessionEntry{}, false
+	}
+	var e sessionEntry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return sessionEntry{}, false
+	}
+	return e, true
+}
+
+func (s Session) putBlob(blobID string, result *analyzer.AnalysisResult) error {
+	b, err := json.Marshal(result)
+	if err != nil {
+		return xerrors.Errorf("failed to marshal the merged layer: %w", err)
+	}
+	if err := s.cache.PutBlob(layerBlobBucket, blobID, b); err != nil {
+		return xerrors.Errorf("failed to cache the merged layer %s: %w", blobID, err)
+	}
+	return nil
+}
+
+// mergeResults combines one analyzer.AnalysisResult per file into the single
+// result applier.ApplyLayers expects for a layer blob: OS is whichever file
+// set it first, everything else is concatenated.
+func mergeResults(results []*analyzer.AnalysisResult) *analyzer.AnalysisResult {
+	merged := &analyzer.AnalysisResult{}
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+		if merged.OS == nil {
+			merged.OS = r.OS
+		}
+		merged.PackageInfos = append(merged.PackageInfos, r.PackageInfos...)
+		merged.Applications = append(merged.Applications, r.Applications...)
+		merged.Misconfigurations = append(merged.Misconfigurations, r.Misconfigurations...)
+	}
+	return merged
+}
+
+// mergeBlobID derives a content-addressed ID for a round's merged layer from
+// the sorted set of file digests it was built from, so two sessions that end
+// up syncing byte-identical trees produce the same blob ID.
+func mergeBlobID(digests []string) string {
+	sorted := append([]string(nil), digests...)
+	sort.Strings(sorted)
+
+	h := sha256.New()
+	for _, d := range sorted {
+		h.Write([]byte(d))
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"golang.org/x/xerrors"
+
+	"github.com/aquasecurity/fanal/analyzer"
+)
+
+// contentHashBucket is the cache.Cache bucket analyzer results keyed by content
+// digest are stored under, separate from the per-layer blob bucket so clearing
+// one doesn't invalidate the other.
+const contentHashBucket = "content-hash"
+
+// ContentHashCache memoizes a single analyzer's output for a given file content,
+// so two layers (or two scans) that happen to contain byte-identical files -
+// e.g. the same /var/lib/dpkg/status or pom.xml - are only analyzed once.
+// Intended callers are the per-analyzer dispatch code that already has a real
+// analyzer.AnalysisResult in hand around an Analyze call, not walker.Walk:
+// WalkFunc returns only an error, so a Walk-level cache lookup has no way to
+// hand a hit's memoized result back to the caller.
+type ContentHashCache struct {
+	cache Cache
+}
+
+// NewContentHashCache wraps an existing cache.Cache with the content-hash bucket.
+func NewContentHashCache(c Cache) ContentHashCache {
+	return ContentHashCache{cache: c}
+}
+
+// key ties the digest to both the analyzer type and its Version(), so bumping
+// an analyzer's Version invalidates every entry it previously wrote without
+// needing an explicit migration.
+func key(analyzerType analyzer.Type, analyzerVersion int, digest string) string {
+	return fmt.Sprintf("%s::%d::%s", analyzerType, analyzerVersion, digest)
+}
+
+// Get returns the memoized result for (analyzerType, analyzerVersion, digest),
+// if any.
+func (c ContentHashCache) Get(analyzerType analyzer.Type, analyzerVersion int, digest string) (*analyzer.AnalysisResult, bool) {
+	b, err := c.cache.GetBlob(contentHashBucket, key(analyzerType, analyzerVersion, digest))
+	if err != nil || b == nil {
+		return nil, false
+	}
+
+	var result analyzer.AnalysisResult
+	if err := json.Unmarshal(b, &result); err != nil {
+		return nil, false
+	}
+	return &result, true
+}
+
+// Put memoizes result for (analyzerType, analyzerVersion, digest).
+func (c ContentHashCache) Put(analyzerType analyzer.Type, analyzerVersion int, digest string, result *analyzer.AnalysisResult) error {
+	b, err := json.Marshal(result)
+	if err != nil {
+		return xerrors.Errorf("failed to marshal the analysis result: %w", err)
+	}
+	if err := c.cache.PutBlob(contentHashBucket, key(analyzerType, analyzerVersion, digest), b); err != nil {
+		return xerrors.Errorf("failed to cache the analysis result: %w", err)
+	}
+	return nil
+}
@@ -4,14 +4,18 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"os"
 	"strings"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/urfave/cli/v2"
 	"golang.org/x/xerrors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 
 	"github.com/aquasecurity/fanal/analyzer"
 	_ "github.com/aquasecurity/fanal/analyzer/all"
@@ -21,6 +25,8 @@ import (
 	aimage "github.com/aquasecurity/fanal/artifact/image"
 	"github.com/aquasecurity/fanal/artifact/local"
 	"github.com/aquasecurity/fanal/artifact/remote"
+	syncartifact "github.com/aquasecurity/fanal/artifact/sync"
+	"github.com/aquasecurity/fanal/artifact/sync/syncpb"
 	"github.com/aquasecurity/fanal/cache"
 	_ "github.com/aquasecurity/fanal/handler/all"
 	"github.com/aquasecurity/fanal/image"
@@ -56,6 +62,15 @@ func run() (err error) {
 						Name:  "skip-dirs",
 						Usage: "skip dirs",
 					},
+					&cli.BoolFlag{
+						Name:  "partial-fetch",
+						Usage: "range-fetch zstd:chunked/eStargz layers instead of downloading them in full",
+					},
+					&cli.IntFlag{
+						Name:  "parallelism",
+						Usage: "number of files to analyze concurrently while walking a layer",
+						Value: 1,
+					},
 				},
 				Action: globalOption(imageAction),
 			},
@@ -96,6 +111,35 @@ func run() (err error) {
 				Usage:   "inspect a remote repository",
 				Action:  globalOption(repoAction),
 			},
+			{
+				Name:  "sync",
+				Usage: "incrementally sync a local directory to a remote scanner",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "server",
+						Usage:    "sync server address (host:port)",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "session-id",
+						Usage:    "stable ID for this local root, so the server recognizes files unchanged since the last sync",
+						Required: true,
+					},
+				},
+				Action: globalOption(syncAction),
+			},
+			{
+				Name:  "sync-server",
+				Usage: "serve the remote side of fanal sync",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "listen",
+						Usage: "address to listen on (host:port)",
+						Value: ":4954",
+					},
+				},
+				Action: globalOption(syncServerAction),
+			},
 		},
 		Flags: []cli.Flag{
 			&cli.BoolFlag{Name: "clear", Aliases: []string{"s"}},
@@ -145,8 +189,10 @@ func initializeCache(backend string) (cache.Cache, error) {
 
 func imageAction(c *cli.Context, fsCache cache.Cache) error {
 	artifactOpt := artifact.Option{
-		SkipFiles: c.StringSlice("skip-files"),
-		SkipDirs:  c.StringSlice("skip-dirs"),
+		SkipFiles:    c.StringSlice("skip-files"),
+		SkipDirs:     c.StringSlice("skip-dirs"),
+		PartialFetch: c.Bool("partial-fetch"),
+		Parallelism:  c.Int("parallelism"),
 
 		MisconfScannerOption: config.ScannerOption{
 			PolicyPaths: c.StringSlice("policy"),
@@ -197,6 +243,55 @@ func repoAction(c *cli.Context, fsCache cache.Cache) error {
 	return inspect(c.Context, art, fsCache)
 }
 
+func syncAction(c *cli.Context, fsCache cache.Cache) error {
+	conn, err := grpc.Dial(c.String("server"), grpc.WithInsecure())
+	if err != nil {
+		return xerrors.Errorf("failed to dial the sync server %s: %w", c.String("server"), err)
+	}
+	defer conn.Close()
+
+	// The server derives its session cache bucket from this header instead of
+	// from anything in the FileMeta stream itself, so it's attached before the
+	// stream is even opened.
+	ctx := metadata.AppendToOutgoingContext(c.Context, syncartifact.SessionIDHeader, c.String("session-id"))
+
+	stream, err := syncpb.NewSyncClient(conn).Session(ctx)
+	if err != nil {
+		return xerrors.Errorf("failed to open a sync session: %w", err)
+	}
+
+	art, err := syncartifact.NewArtifact(c.Args().First(), syncartifact.NewGRPCTransport(stream), artifact.Option{
+		SkipFiles: c.StringSlice("skip-files"),
+		SkipDirs:  c.StringSlice("skip-dirs"),
+	})
+	if err != nil {
+		return err
+	}
+	return inspect(c.Context, art, fsCache)
+}
+
+// syncServerAction serves the remote half of fanal sync: it registers a
+// syncartifact.Service with a grpc.Server and blocks until the listener is
+// closed, analyzing whatever each connected client streams it with the same
+// analyzer.AnalyzerGroup the image/filesystem/repository commands use.
+func syncServerAction(c *cli.Context, fsCache cache.Cache) error {
+	lis, err := net.Listen("tcp", c.String("listen"))
+	if err != nil {
+		return xerrors.Errorf("failed to listen on %s: %w", c.String("listen"), err)
+	}
+
+	analyzerGroup := analyzer.NewAnalyzerGroup()
+	analyzeFn := func(path string, content io.Reader) (*analyzer.AnalysisResult, error) {
+		return analyzerGroup.AnalyzeFile(c.Context, path, content)
+	}
+
+	srv := grpc.NewServer()
+	syncpb.RegisterSyncServer(srv, syncartifact.NewService(fsCache, analyzeFn))
+
+	log.Printf("sync server listening on %s", c.String("listen"))
+	return srv.Serve(lis)
+}
+
 func inspect(ctx context.Context, art artifact.Artifact, c cache.LocalArtifactCache) error {
 	imageInfo, err := art.Inspect(ctx)
 	if err != nil {
@@ -0,0 +1,82 @@
+package walker
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+)
+
+func buildEStargzFooter(t *testing.T, entries []TOCEntry) []byte {
+	t.Helper()
+
+	payload, err := json.Marshal(struct {
+		Entries []TOCEntry `json:"entries"`
+	}{Entries: entries})
+	if err != nil {
+		t.Fatalf("failed to marshal TOC: %v", err)
+	}
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write(payload); err != nil {
+		t.Fatalf("failed to gzip TOC: %v", err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("failed to close gzip writer: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func buildZstdChunkedFooter(t *testing.T, entries []TOCEntry) []byte {
+	t.Helper()
+
+	payload, err := json.Marshal(entries)
+	if err != nil {
+		t.Fatalf("failed to marshal TOC: %v", err)
+	}
+
+	var buf bytes.Buffer
+	magic := make([]byte, 4)
+	binary.LittleEndian.PutUint32(magic, zstdSkippableFrameMagic)
+	buf.Write(magic)
+
+	size := make([]byte, 4)
+	binary.LittleEndian.PutUint32(size, uint32(len(payload)))
+	buf.Write(size)
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+func TestParseTOCEStargz(t *testing.T) {
+	want := []TOCEntry{{Name: "etc/os-release", Type: "reg", Size: 42}}
+	footer := buildEStargzFooter(t, want)
+
+	entries, err := ParseTOC(footer, "")
+	if err != nil {
+		t.Fatalf("ParseTOC failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name != want[0].Name || entries[0].Size != want[0].Size {
+		t.Fatalf("got %+v, want %+v", entries, want)
+	}
+}
+
+func TestParseTOCZstdChunked(t *testing.T) {
+	want := []TOCEntry{{Name: "var/lib/rpm/Packages", Type: "reg", Size: 7}}
+	footer := buildZstdChunkedFooter(t, want)
+
+	entries, err := ParseTOC(footer, "")
+	if err != nil {
+		t.Fatalf("ParseTOC failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name != want[0].Name {
+		t.Fatalf("got %+v, want %+v", entries, want)
+	}
+}
+
+func TestParseTOCNoTOC(t *testing.T) {
+	if _, err := ParseTOC([]byte("not a toc"), ""); err != ErrNoTOC {
+		t.Fatalf("got err %v, want ErrNoTOC", err)
+	}
+}
@@ -0,0 +1,56 @@
+package walker
+
+import (
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// isGlobPattern reports whether s contains glob metacharacters and therefore
+// needs matching via doublestar, as opposed to the plain literal paths
+// shouldSkipFile/shouldSkipDir have always handled by prefix/exact comparison.
+func isGlobPattern(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// splitLiteralAndGlob separates plain paths (left untouched, so existing
+// behavior for exact/prefix matches is unchanged) from doublestar patterns
+// like "**/node_modules/**" or "var/log/**".
+func splitLiteralAndGlob(patterns []string) (literal, globs []string) {
+	for _, p := range patterns {
+		if isGlobPattern(p) {
+			globs = append(globs, p)
+		} else {
+			literal = append(literal, p)
+		}
+	}
+	return literal, globs
+}
+
+// validateGlobs pre-checks every pattern once at construction time, so a typo
+// in a skip pattern surfaces as soon as the walker is built rather than
+// silently never matching mid-scan.
+func validateGlobs(patterns []string) error {
+	for _, p := range patterns {
+		if !doublestar.ValidatePattern(p) {
+			return invalidGlobError(p)
+		}
+	}
+	return nil
+}
+
+type invalidGlobError string
+
+func (e invalidGlobError) Error() string {
+	return "invalid glob skip pattern: " + string(e)
+}
+
+// matchAnyGlob reports whether path matches any of the pre-validated patterns.
+func matchAnyGlob(patterns []string, path string) bool {
+	for _, p := range patterns {
+		if ok, _ := doublestar.Match(p, path); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package walker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsGlobPattern(t *testing.T) {
+	tests := map[string]bool{
+		"etc/os-release":       false,
+		"var/lib/rpm/Packages": false,
+		"**/*.jar":             true,
+		"etc/*.conf":           true,
+		"var/log/[ab]*":        true,
+	}
+	for pattern, want := range tests {
+		if got := isGlobPattern(pattern); got != want {
+			t.Errorf("isGlobPattern(%q) = %v, want %v", pattern, got, want)
+		}
+	}
+}
+
+func TestSplitLiteralAndGlob(t *testing.T) {
+	literal, globs := splitLiteralAndGlob([]string{"etc/os-release", "**/*.jar", "var/lib/rpm/Packages", "etc/*.conf"})
+
+	wantLiteral := []string{"etc/os-release", "var/lib/rpm/Packages"}
+	wantGlobs := []string{"**/*.jar", "etc/*.conf"}
+	if !reflect.DeepEqual(literal, wantLiteral) {
+		t.Errorf("literal = %v, want %v", literal, wantLiteral)
+	}
+	if !reflect.DeepEqual(globs, wantGlobs) {
+		t.Errorf("globs = %v, want %v", globs, wantGlobs)
+	}
+}
+
+func TestValidateGlobs(t *testing.T) {
+	if err := validateGlobs([]string{"**/*.jar", "etc/*.conf"}); err != nil {
+		t.Errorf("validateGlobs: unexpected error: %v", err)
+	}
+	if err := validateGlobs([]string{"etc/[unterminated"}); err == nil {
+		t.Error("validateGlobs: want error for invalid pattern, got none")
+	}
+}
+
+func TestMatchAnyGlob(t *testing.T) {
+	patterns := []string{"**/*.jar", "var/log/**"}
+	tests := map[string]bool{
+		"app/lib/foo.jar":  true,
+		"var/log/messages": true,
+		"etc/os-release":   false,
+	}
+	for path, want := range tests {
+		if got := matchAnyGlob(patterns, path); got != want {
+			t.Errorf("matchAnyGlob(%v, %q) = %v, want %v", patterns, path, got, want)
+		}
+	}
+}
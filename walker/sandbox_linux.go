@@ -0,0 +1,110 @@
+//go:build linux
+
+package walker
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/xerrors"
+)
+
+// SandboxExtract writes r to a file named filepath.Base(name) under root, after
+// pivoting the extracting goroutine's OS thread into a private mount namespace
+// chrooted at root. A crafted tar entry that tries to reach outside root via a
+// symlink planted by an earlier header can't resolve past the new root, because
+// root is now "/" for this thread. It returns the path of the written file as
+// seen from the caller's (unchanged) root, i.e. still under the original root.
+// When the mount namespace can't be unshared, it writes without the jail, via
+// writeGuarded.
+//
+// It's exported so any caller extracting untrusted content into a local
+// directory can reuse this jail instead of reimplementing pivot_root.
+// LayerTar.spool is its only caller; the local and remote filesystem walkers
+// (artifact/local, artifact/remote) don't go through it.
+func SandboxExtract(root, name string, r io.Reader) (string, error) {
+	base := filepath.Base(filepath.Clean(name))
+	if base == "." || base == ".." || base == "" {
+		base = "trivy-file"
+	}
+
+	errCh := make(chan error, 1)
+	go pivotAndWrite(root, base, r, errCh)
+	if err := <-errCh; err != nil {
+		return "", err
+	}
+	return filepath.Join(root, base), nil
+}
+
+// pivotAndWrite runs on its own goroutine. Once unix.Unshare(CLONE_NEWNS)
+// succeeds, the OS thread it's running on has a chrooted mount namespace for
+// the rest of its life, so this deliberately never calls
+// runtime.UnlockOSThread() after that point: unlocking would return the
+// still-pivoted thread to the scheduler's pool, and whichever unrelated
+// goroutine got scheduled onto it next would silently inherit root as its
+// filesystem root. Letting this goroutine (and its locked thread) simply exit
+// keeps the mutation contained to a thread nothing else will ever reuse.
+func pivotAndWrite(root, base string, r io.Reader, errCh chan<- error) {
+	runtime.LockOSThread()
+
+	if err := unix.Unshare(unix.CLONE_NEWNS); err != nil {
+		// Unprivileged callers (no CAP_SYS_ADMIN, no unprivileged user
+		// namespaces) can't unshare the mount namespace; the thread's root is
+		// untouched, so it's safe to give it back to the pool and fall back to
+		// the path-escape check so extraction still works, just without the jail.
+		runtime.UnlockOSThread()
+		errCh <- writeGuarded(root, base, r)
+		return
+	}
+
+	errCh <- func() error {
+		if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+			return xerrors.Errorf("failed to make mounts private: %w", err)
+		}
+		if err := unix.Mount(root, root, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return xerrors.Errorf("failed to bind-mount sandbox root: %w", err)
+		}
+		if err := unix.Chdir(root); err != nil {
+			return xerrors.Errorf("failed to chdir into sandbox root: %w", err)
+		}
+		if err := unix.PivotRoot(".", "."); err != nil {
+			return xerrors.Errorf("failed to pivot_root into sandbox root: %w", err)
+		}
+		defer unix.Unmount(".", unix.MNT_DETACH)
+
+		f, err := os.Create(filepath.Join("/", base))
+		if err != nil {
+			return xerrors.Errorf("failed to create the sandboxed temp file: %w", err)
+		}
+		defer f.Close()
+
+		if _, err := io.Copy(f, r); err != nil {
+			return xerrors.Errorf("failed to copy into the sandbox: %w", err)
+		}
+		return nil
+	}()
+	// No runtime.UnlockOSThread() here: see the doc comment above.
+}
+
+// writeGuarded is the no-privilege fallback: it rejects names that would
+// resolve outside root instead of relying on a mount namespace to contain them.
+func writeGuarded(root, base string, r io.Reader) error {
+	dest := filepath.Join(root, base)
+	if rel, err := filepath.Rel(root, dest); err != nil || hasDotDotPrefix(rel) {
+		return xerrors.Errorf("refusing to write outside sandbox root: %s", dest)
+	}
+
+	f, err := os.Create(dest)
+	if err != nil {
+		return xerrors.Errorf("failed to create the temp file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return xerrors.Errorf("failed to copy: %w", err)
+	}
+	return nil
+}
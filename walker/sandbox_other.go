@@ -0,0 +1,38 @@
+//go:build !linux
+
+package walker
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/xerrors"
+)
+
+// SandboxExtract is the non-Linux fallback: there is no pivot_root/unshare
+// equivalent wired up here, so it falls back to rejecting any entry whose
+// cleaned destination would escape root, which is the minimum containment
+// walker.Options{Sandbox: true} promises on every platform.
+func SandboxExtract(root, name string, r io.Reader) (string, error) {
+	base := filepath.Base(filepath.Clean(name))
+	if base == "." || base == ".." || base == "" {
+		base = "trivy-file"
+	}
+
+	dest := filepath.Join(root, base)
+	if rel, err := filepath.Rel(root, dest); err != nil || hasDotDotPrefix(rel) {
+		return "", xerrors.Errorf("refusing to write outside sandbox root: %s", dest)
+	}
+
+	f, err := os.Create(dest)
+	if err != nil {
+		return "", xerrors.Errorf("failed to create the temp file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return "", xerrors.Errorf("failed to copy: %w", err)
+	}
+	return dest, nil
+}
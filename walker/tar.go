@@ -2,7 +2,11 @@ package walker
 
 import (
 	"archive/tar"
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
 	"io/ioutil"
 	"os"
@@ -10,6 +14,8 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/klauspost/pgzip"
+	"golang.org/x/sync/errgroup"
 	"golang.org/x/xerrors"
 )
 
@@ -20,17 +26,110 @@ const (
 
 type LayerTar struct {
 	walker
+	sandbox       bool
+	digests       *digestStore
+	parallelism   int
+	skipFileGlobs []string
+	skipDirGlobs  []string
+	globErr       error
 }
 
 func NewLayerTar(skipFiles, skipDirs []string) LayerTar {
-	return LayerTar{
-		walker: newWalker(skipFiles, skipDirs),
+	return NewLayerTarWithOptions(Options{SkipFiles: skipFiles, SkipDirs: skipDirs})
+}
+
+// digestStore records the content digest computed for each file as it's
+// streamed to an analyzer, so callers can look it up after Walk returns,
+// without re-reading the file, via Digest.
+type digestStore struct {
+	mu sync.Mutex
+	m  map[string]string
+}
+
+func (s *digestStore) set(path, digest string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m[path] = digest
+}
+
+func (s *digestStore) get(path string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.m[path]
+	return d, ok
+}
+
+// Digest returns the sha256 hex digest last recorded for path by any Walk of
+// w, if that file was ever opened through its opener. Digests are kept across
+// Walks, not reset at the start of each one.
+func (w LayerTar) Digest(path string) (string, bool) {
+	return w.digests.get(path)
+}
+
+// Options controls how a walker traverses a layer and extracts large files that
+// spill to disk. Sandbox, when true, routes the temp-file path through
+// SandboxExtract: a pivot_root jail at the destination root on Linux when the
+// mount namespace can be unshared, and otherwise only a check that refuses a
+// destination outside that root.
+// SkipFiles/SkipDirs accept doublestar glob syntax ("*", "?", "**", "[...]") in
+// addition to the plain literal paths they've always accepted; a pattern with
+// no glob metacharacters is still matched exactly/by-prefix as before.
+type Options struct {
+	SkipFiles []string
+	SkipDirs  []string
+	Sandbox   bool
+	// Parallelism bounds how many analyzeFn calls Walk runs concurrently.
+	// Zero or negative means serial, matching the pre-existing behavior.
+	Parallelism int
+}
+
+// NewLayerTarWithOptions is like NewLayerTar but accepts the full Options set.
+func NewLayerTarWithOptions(opt Options) LayerTar {
+	literalFiles, globFiles := splitLiteralAndGlob(opt.SkipFiles)
+	literalDirs, globDirs := splitLiteralAndGlob(opt.SkipDirs)
+
+	lt := LayerTar{
+		walker:        newWalker(literalFiles, literalDirs),
+		sandbox:       opt.Sandbox,
+		digests:       &digestStore{m: map[string]string{}},
+		parallelism:   opt.Parallelism,
+		skipFileGlobs: globFiles,
+		skipDirGlobs:  globDirs,
 	}
+	lt.globErr = validateGlobs(append(append([]string{}, globFiles...), globDirs...))
+	return lt
 }
 
-func (w LayerTar) Walk(layer io.Reader, analyzeFn WalkFunc) ([]string, []string, error) {
+// Walk reads a (possibly gzip-compressed) layer tar and hands every file that
+// isn't skipped to analyzeFn. Entries are still read from the tar stream one at
+// a time, and each file's raw bytes are still spooled (see spool) on this same
+// goroutine, since archive/tar can't be read from concurrently. But when
+// w.parallelism > 1, the CPU-bound parts - hashing (fileOpener) and analyzeFn
+// itself - run on a bounded worker pool instead of inline, so they overlap
+// across files. opqDirs, whFiles and skipDirs are only ever touched by the
+// reading goroutine, so the returned opqDirs and whFiles come back in tar
+// order regardless of how analyzeFn is scheduled.
+func (w LayerTar) Walk(ctx context.Context, layer io.Reader, analyzeFn WalkFunc) ([]string, []string, error) {
+	if w.globErr != nil {
+		return nil, nil, w.globErr
+	}
+
+	gr, err := decompress(layer)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to decompress the layer: %w", err)
+	}
+	defer gr.Close()
+
+	parallelism := w.parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	eg, egCtx := errgroup.WithContext(ctx)
+	sem := make(chan struct{}, parallelism)
+
 	var opqDirs, whFiles, skipDirs []string
-	tr := tar.NewReader(layer)
+	tr := tar.NewReader(gr)
 	for {
 		hdr, err := tr.Next()
 		if err == io.EOF {
@@ -58,12 +157,12 @@ func (w LayerTar) Walk(layer io.Reader, analyzeFn WalkFunc) ([]string, []string,
 
 		switch hdr.Typeflag {
 		case tar.TypeDir:
-			if w.shouldSkipDir(filePath) {
+			if w.shouldSkipDir(filePath) || matchAnyGlob(w.skipDirGlobs, filePath) {
 				skipDirs = append(skipDirs, filePath)
 				continue
 			}
 		case tar.TypeSymlink, tar.TypeLink, tar.TypeReg:
-			if w.shouldSkipFile(filePath) {
+			if w.shouldSkipFile(filePath) || matchAnyGlob(w.skipFileGlobs, filePath) {
 				continue
 			}
 		default:
@@ -74,15 +173,78 @@ func (w LayerTar) Walk(layer io.Reader, analyzeFn WalkFunc) ([]string, []string,
 			continue
 		}
 
-		// A symbolic/hard link or regular file will reach here.
-		err = analyzeFn(filePath, hdr.FileInfo(), w.fileWithTarOpener(hdr.FileInfo(), tr))
+		if egCtx.Err() != nil {
+			break
+		}
+
+		// A symbolic/hard link or regular file will reach here. archive/tar only
+		// exposes the current entry's bytes until the next tr.Next() call, so
+		// the raw copy (to memory, or to a temp file for ThresholdSize+ files)
+		// has to happen here on the single reading goroutine; there's no way
+		// around that with a streaming tar reader. What doesn't have to happen
+		// here is hashing: spool() only moves bytes, and the CPU-bound digest
+		// computation is deferred to fileOpener's once.Do, which runs on the
+		// worker goroutine below so it actually overlaps across files.
+		fi := hdr.FileInfo()
+		sp, cleanup, err := w.spool(filePath, fi, tr)
 		if err != nil {
-			return nil, nil, xerrors.Errorf("failed to analyze file: %w", err)
+			return nil, nil, xerrors.Errorf("failed to read file: %w", err)
+		}
+
+		fp := filePath
+		opener := w.fileOpener(fp, fi, sp)
+		select {
+		case sem <- struct{}{}:
+		case <-egCtx.Done():
+			cleanup()
+			goto done
 		}
+		eg.Go(func() error {
+			defer func() { <-sem }()
+			defer cleanup()
+
+			if err := analyzeFn(fp, fi, opener); err != nil {
+				return xerrors.Errorf("failed to analyze file: %w", err)
+			}
+			return nil
+		})
+	}
+done:
+
+	if err := eg.Wait(); err != nil {
+		return nil, nil, err
 	}
 	return opqDirs, whFiles, nil
 }
 
+// decompress wraps layer in a pgzip reader when it looks gzip-compressed
+// (multi-goroutine gunzip is the dominant cost on large Debian/Ubuntu layers),
+// and passes it through unchanged otherwise. The returned ReadCloser must
+// always be closed by the caller, even in the pass-through case.
+func decompress(layer io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(layer)
+	magic, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, xerrors.Errorf("failed to peek the layer: %w", err)
+	}
+
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gr, err := pgzip.NewReader(br)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to open the gzip stream: %w", err)
+		}
+		return gr, nil
+	}
+	return ioutil.NopCloser(br), nil
+}
+
+// hasDotDotPrefix reports whether a filepath.Rel result climbs above its base,
+// i.e. is "..", or starts with "../". Used by the sandbox fallbacks to refuse
+// writing outside their destination root.
+func hasDotDotPrefix(rel string) bool {
+	return rel == ".." || strings.HasPrefix(rel, "../")
+}
+
 func underSkippedDir(filePath string, skipDirs []string) bool {
 	for _, skipDir := range skipDirs {
 		rel, err := filepath.Rel(skipDir, filePath)
@@ -96,70 +258,101 @@ func underSkippedDir(filePath string, skipDirs []string) bool {
 	return false
 }
 
-// fileWithTarOpener opens a file in a Tar.
-// If the file size is greater than or equal to ThresholdSize(200MB), it writes the file and caches the file name.
-// If the file size is less than ThresholdSize(200MB), it opens the file once and the content is shared so that some analyzers can use the same data
-func (w *walker) fileWithTarOpener(fi os.FileInfo, r io.Reader) func() (io.ReadCloser, func() error, error) {
+// spooledFile is the raw content of one tar entry, moved out of the tar
+// stream (to memory, or to a temp file for ThresholdSize+ files) during the
+// single pass archive/tar allows over it. It carries no digest yet; that's
+// computed lazily by fileOpener.
+type spooledFile struct {
+	b            []byte
+	tempFilePath string
+	tempDirPath  string
+}
 
+// spool moves filePath's content out of r (the tar reader, positioned at this
+// entry) and into sp, either in memory or, for files >= ThresholdSize, a temp
+// file (sandboxed via SandboxExtract when w.sandbox is set). This is the part
+// of materializing a tar entry that can't be deferred to a worker goroutine,
+// since r stops being readable the moment the caller advances to the next
+// entry.
+func (w LayerTar) spool(filePath string, fi os.FileInfo, r io.Reader) (spooledFile, func() error, error) {
+	if fi.Size() >= ThresholdSize {
+		tempDirPath, err := ioutil.TempDir("", "trivy-*")
+		if err != nil {
+			return spooledFile{}, nil, xerrors.Errorf("failed to create the temp dir: %w", err)
+		}
+		cleanup := func() error {
+			if err := os.RemoveAll(tempDirPath); err != nil {
+				return xerrors.Errorf("failed to remove all: %w", err)
+			}
+			return nil
+		}
+
+		if w.sandbox {
+			tempFilePath, err := SandboxExtract(tempDirPath, filePath, r)
+			if err != nil {
+				return spooledFile{}, nil, xerrors.Errorf("failed to extract the file in the sandbox: %w", err)
+			}
+			return spooledFile{tempFilePath: tempFilePath, tempDirPath: tempDirPath}, cleanup, nil
+		}
+
+		f, err := os.CreateTemp(tempDirPath, "trivy-*")
+		if err != nil {
+			return spooledFile{}, nil, xerrors.Errorf("failed to create the temp file: %w", err)
+		}
+		defer f.Close()
+
+		if _, err := io.Copy(f, r); err != nil {
+			return spooledFile{}, nil, xerrors.Errorf("failed to copy: %w", err)
+		}
+		return spooledFile{tempFilePath: f.Name(), tempDirPath: tempDirPath}, cleanup, nil
+	}
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return spooledFile{}, nil, xerrors.Errorf("unable to read the file: %w", err)
+	}
+	return spooledFile{b: b}, func() error { return nil }, nil
+}
+
+// fileOpener returns a lazy, once-only opener over an already-spooled tar
+// entry. The digest is computed on the first call, not by spool, so that
+// hashing - the CPU-bound part of materializing a file - runs on whichever
+// worker goroutine ends up analyzing filePath instead of on the single
+// goroutine reading the tar stream.
+func (w LayerTar) fileOpener(filePath string, fi os.FileInfo, sp spooledFile) func() (io.ReadCloser, func() error, error) {
 	var once sync.Once
-	var b []byte
-	var tempFilePath string
-	var tempDirPath string
-	var err error
 
 	return func() (io.ReadCloser, func() error, error) {
+		var err error
 		once.Do(func() {
-			if fi.Size() >= ThresholdSize {
-				var f *os.File
-				tempDirPath, err = ioutil.TempDir("", "trivy-*")
-				if err != nil {
-					err = xerrors.Errorf("failed to create the temp dir: %w", err)
-					return
-				}
-
-				f, err = os.CreateTemp(tempDirPath, "trivy-*")
-				if err != nil {
-					err = xerrors.Errorf("failed to create the temp file: %w", err)
+			h := sha256.New()
+			if sp.tempFilePath != "" {
+				f, oerr := os.Open(sp.tempFilePath)
+				if oerr != nil {
+					err = xerrors.Errorf("failed to open the temp file: %w", oerr)
 					return
 				}
-
-				_, err = io.Copy(f, r)
-				if err != nil {
-					err = xerrors.Errorf("failed to copy: %w", err)
+				defer f.Close()
+				if _, cerr := io.Copy(h, f); cerr != nil {
+					err = xerrors.Errorf("failed to hash the temp file: %w", cerr)
 					return
 				}
-
-				tempFilePath = f.Name()
 			} else {
-				b, err = io.ReadAll(r)
-				if err != nil {
-					err = xerrors.Errorf("unable to read the file: %w", err)
-					return
-				}
+				h.Write(sp.b)
 			}
+			w.digests.set(filePath, hex.EncodeToString(h.Sum(nil)))
 		})
 		if err != nil {
-			return nil, nil, xerrors.Errorf("failed to once do: %w", err)
+			return nil, nil, xerrors.Errorf("failed to hash file: %w", err)
 		}
 
-		if fi.Size() >= ThresholdSize {
-			f, err := os.Open(tempFilePath)
+		if sp.tempFilePath != "" {
+			f, err := os.Open(sp.tempFilePath)
 			if err != nil {
 				return nil, nil, xerrors.Errorf("failed to open the temp file: %w", err)
 			}
-
-			return f, func() error {
-				if err := os.RemoveAll(tempDirPath); err != nil {
-					return xerrors.Errorf("failed to remove all: %w", err)
-				}
-				return nil
-			}, nil
-		} else {
-			return io.NopCloser(bytes.NewReader(b)),
-				func() error {
-					b = []byte{}
-					return nil
-				}, nil
+			return f, func() error { return nil }, nil
 		}
+		return io.NopCloser(bytes.NewReader(sp.b)), func() error { return nil }, nil
 	}
 }